@@ -0,0 +1,190 @@
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	kapiv1 "k8s.io/api/core/v1"
+
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+)
+
+// CollectedArtifact describes a single file written into a DumpCollector bundle, for
+// inclusion in the bundle's manifest.json.
+type CollectedArtifact struct {
+	// Path is relative to the bundle root.
+	Path string `json:"path"`
+	// Reason explains why this artifact was collected.
+	Reason string `json:"reason"`
+}
+
+// DumpCollector writes a hierarchical bundle of debug artifacts under $ARTIFACT_DIR so
+// that CI failures can be triaged from the collected files instead of scraping Ginkgo
+// output. When $ARTIFACT_DIR is unset, all Add* methods are no-ops and callers should
+// continue to log inline for local runs.
+type DumpCollector struct {
+	root string
+
+	mu        sync.Mutex
+	artifacts []CollectedArtifact
+}
+
+// NewDumpCollector returns a DumpCollector rooted at a fresh subdirectory of
+// $ARTIFACT_DIR named after name. If $ARTIFACT_DIR is not set, the returned collector
+// silently discards everything written to it.
+func NewDumpCollector(name string) *DumpCollector {
+	base := os.Getenv("ARTIFACT_DIR")
+	if len(base) == 0 {
+		return &DumpCollector{}
+	}
+	root := filepath.Join(base, "dump-"+name+"-"+time.Now().UTC().Format("20060102-150405"))
+	if err := os.MkdirAll(root, 0755); err != nil {
+		e2e.Logf("DumpCollector: could not create bundle dir %s: %v", root, err)
+		return &DumpCollector{}
+	}
+	return &DumpCollector{root: root}
+}
+
+// Enabled reports whether this collector is actually writing to disk.
+func (d *DumpCollector) Enabled() bool {
+	return d != nil && len(d.root) > 0
+}
+
+func (d *DumpCollector) write(relPath, reason string, content []byte) {
+	if !d.Enabled() {
+		return
+	}
+	full := filepath.Join(d.root, relPath)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		e2e.Logf("DumpCollector: could not create dir for %s: %v", relPath, err)
+		return
+	}
+	if err := ioutil.WriteFile(full, content, 0644); err != nil {
+		e2e.Logf("DumpCollector: could not write %s: %v", relPath, err)
+		return
+	}
+	d.mu.Lock()
+	d.artifacts = append(d.artifacts, CollectedArtifact{Path: relPath, Reason: reason})
+	d.mu.Unlock()
+}
+
+// AddPodDescribe writes the describe output for a pod to pods/<name>/describe.yaml.
+func (d *DumpCollector) AddPodDescribe(oc *CLI, pod *kapiv1.Pod, reason string) {
+	if !d.Enabled() {
+		return
+	}
+	out, err := oc.AsAdmin().Run("describe").WithoutNamespace().Args("pod/"+pod.Name, "-n", pod.Namespace).Output()
+	if err != nil {
+		e2e.Logf("DumpCollector: error describing pod %s: %v", pod.Name, err)
+		return
+	}
+	d.write(filepath.Join("pods", pod.Name, "describe.yaml"), reason, []byte(out))
+}
+
+// AddPodContainerLog writes a single container's log to
+// pods/<name>/containers/<container>.log.
+func (d *DumpCollector) AddPodContainerLog(oc *CLI, pod *kapiv1.Pod, container, reason string) {
+	if !d.Enabled() {
+		return
+	}
+	out, err := oc.AsAdmin().Run("logs").WithoutNamespace().Args("pod/"+pod.Name, "-c", container, "-n", pod.Namespace).Output()
+	if err != nil {
+		e2e.Logf("DumpCollector: error retrieving logs for %s/%s: %v", pod.Name, container, err)
+		return
+	}
+	d.write(filepath.Join("pods", pod.Name, "containers", container+".log"), reason, []byte(out))
+}
+
+// AddPod writes the describe output and every container log for a pod.
+func (d *DumpCollector) AddPod(oc *CLI, pod *kapiv1.Pod, reason string) {
+	if !d.Enabled() {
+		return
+	}
+	d.AddPodDescribe(oc, pod, reason)
+	for _, c := range pod.Spec.InitContainers {
+		d.AddPodContainerLog(oc, pod, c.Name, reason)
+	}
+	for _, c := range pod.Spec.Containers {
+		d.AddPodContainerLog(oc, pod, c.Name, reason)
+	}
+}
+
+// AddBuild writes a build's YAML to builds/<name>.yaml.
+func (d *DumpCollector) AddBuild(oc *CLI, name, reason string) {
+	if !d.Enabled() {
+		return
+	}
+	out, err := oc.AsAdmin().Run("get").Args("build", name, "-o", "yaml").Output()
+	if err != nil {
+		e2e.Logf("DumpCollector: error retrieving build %s: %v", name, err)
+		return
+	}
+	d.write(filepath.Join("builds", name+".yaml"), reason, []byte(out))
+}
+
+// AddImageStream writes an imagestream's YAML to imagestreams/<ns>/<is>.yaml.
+func (d *DumpCollector) AddImageStream(oc *CLI, namespace, name, reason string) {
+	if !d.Enabled() {
+		return
+	}
+	out, err := oc.AsAdmin().Run("get").Args("is", name, "-n", namespace, "-o", "yaml").Output()
+	if err != nil {
+		e2e.Logf("DumpCollector: error retrieving imagestream %s/%s: %v", namespace, name, err)
+		return
+	}
+	d.write(filepath.Join("imagestreams", namespace, name+".yaml"), reason, []byte(out))
+}
+
+// AddOperator writes a ClusterOperator's YAML to operators/<name>.yaml.
+func (d *DumpCollector) AddOperator(oc *CLI, name, reason string) {
+	if !d.Enabled() {
+		return
+	}
+	out, err := oc.AsAdmin().Run("get").Args("co", name, "-o", "yaml").Output()
+	if err != nil {
+		e2e.Logf("DumpCollector: error retrieving clusteroperator %s: %v", name, err)
+		return
+	}
+	d.write(filepath.Join("operators", name+".yaml"), reason, []byte(out))
+}
+
+// AddGoroutineDump writes the output of the master's pprof goroutine dump to
+// pprof/goroutine.txt.
+func (d *DumpCollector) AddGoroutineDump(oc *CLI, reason string) {
+	if !d.Enabled() {
+		return
+	}
+	out, err := oc.AsAdmin().Run("get").Args("--raw", "/debug/pprof/goroutine?debug=2").Output()
+	if err != nil {
+		e2e.Logf("DumpCollector: error retrieving goroutine dump: %v", err)
+		return
+	}
+	d.write(filepath.Join("pprof", "goroutine.txt"), reason, []byte(out))
+}
+
+// AddRaw writes arbitrary content to relPath, recording reason in the manifest.
+func (d *DumpCollector) AddRaw(relPath, reason string, content []byte) {
+	d.write(relPath, reason, content)
+}
+
+// Finish writes manifest.json listing every artifact collected. It is safe to call
+// Finish multiple times; the manifest is simply rewritten.
+func (d *DumpCollector) Finish() error {
+	if !d.Enabled() {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	manifest := struct {
+		Artifacts []CollectedArtifact `json:"artifacts"`
+	}{Artifacts: d.artifacts}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(d.root, "manifest.json"), b, 0644)
+}
@@ -0,0 +1,268 @@
+package util
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/apitesting"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+// buildSummary is the JSON document written to builds/<name>/summary.json; it captures
+// just enough of a build's lifecycle for a CI dashboard to summarize a run without
+// having to parse build.yaml.
+type buildSummary struct {
+	Name             string            `json:"name"`
+	Namespace        string            `json:"namespace"`
+	BuildConfig      string            `json:"buildConfig,omitempty"`
+	Phase            string            `json:"phase"`
+	Success          bool              `json:"success"`
+	Failure          bool              `json:"failure"`
+	Cancelled        bool              `json:"cancelled"`
+	Timeout          bool              `json:"timeout"`
+	StartedAt        *time.Time        `json:"startedAt,omitempty"`
+	CompletedAt      *time.Time        `json:"completedAt,omitempty"`
+	DurationMs       int64             `json:"durationMs,omitempty"`
+	PushTarget       string            `json:"pushTarget,omitempty"`
+	PullTarget       string            `json:"pullTarget,omitempty"`
+	ArtifactPaths    []string          `json:"artifactPaths"`
+	PhaseTransitions []PhaseTransition `json:"phaseTransitions,omitempty"`
+}
+
+// mergedEvent is a single build or pod event normalized for time-sorted, merged
+// output to builds/<name>/events.txt.
+type mergedEvent struct {
+	Time    time.Time
+	Source  string
+	Reason  string
+	Message string
+}
+
+// CollectArtifacts writes a per-build directory under the shared DumpCollector
+// containing the build YAML, the build pod spec (if one exists), build and pod events
+// merged and sorted by time, each container's log, the registry log, and a
+// summary.json capturing phase, timing, and push/pull targets. It returns the
+// collector-relative paths written, for inclusion in a JUnit report.
+func (t *BuildResult) CollectArtifacts() []string {
+	collector := defaultDumpCollector()
+	if !collector.Enabled() || t == nil || t.Build == nil {
+		return nil
+	}
+	base := filepath.Join("builds", t.BuildName)
+	var paths []string
+
+	if out, err := t.Oc.AsAdmin().Run("get").Args("build", t.BuildName, "-o", "yaml").Output(); err == nil {
+		p := filepath.Join(base, "build.yaml")
+		collector.AddRaw(p, "build resource collected by BuildResult.CollectArtifacts", []byte(out))
+		paths = append(paths, p)
+	}
+
+	podName := buildPodName(t.Build)
+	if pod, err := t.Oc.AdminKubeClient().CoreV1().Pods(t.Oc.Namespace()).Get(podName, metav1.GetOptions{}); err == nil {
+		if out, err := t.Oc.AsAdmin().Run("get").Args("pod", podName, "-o", "yaml").Output(); err == nil {
+			p := filepath.Join(base, "pod.yaml")
+			collector.AddRaw(p, "build pod spec collected by BuildResult.CollectArtifacts", []byte(out))
+			paths = append(paths, p)
+		}
+		for _, c := range pod.Spec.Containers {
+			if out, err := t.Oc.AsAdmin().Run("logs").WithoutNamespace().Args("pod/"+podName, "-c", c.Name, "-n", pod.Namespace).Output(); err == nil {
+				p := filepath.Join(base, "containers", c.Name+".log")
+				collector.AddRaw(p, "build pod container log collected by BuildResult.CollectArtifacts", []byte(out))
+				paths = append(paths, p)
+			}
+		}
+	}
+
+	if events := t.mergedEvents(podName); len(events) > 0 {
+		p := filepath.Join(base, "events.txt")
+		collector.AddRaw(p, "merged, time-sorted build and pod events", []byte(formatMergedEvents(events)))
+		paths = append(paths, p)
+	}
+
+	if regLog, err := t.dumpRegistryLogsToString(); err == nil {
+		p := filepath.Join(base, "registry.log")
+		collector.AddRaw(p, "registry log collected by BuildResult.CollectArtifacts", []byte(regLog))
+		paths = append(paths, p)
+	}
+
+	summary := t.summary(paths)
+	if b, err := json.MarshalIndent(summary, "", "  "); err == nil {
+		p := filepath.Join(base, "summary.json")
+		collector.AddRaw(p, "build summary collected by BuildResult.CollectArtifacts", b)
+		paths = append(paths, p)
+	}
+
+	return paths
+}
+
+func (t *BuildResult) summary(paths []string) buildSummary {
+	b := t.Build
+	s := buildSummary{
+		Name:             b.Name,
+		Namespace:        b.Namespace,
+		BuildConfig:      t.BuildConfigName,
+		Phase:            string(b.Status.Phase),
+		Success:          t.BuildSuccess,
+		Failure:          t.BuildFailure,
+		Cancelled:        t.BuildCancelled,
+		Timeout:          t.BuildTimeout,
+		ArtifactPaths:    paths,
+		PhaseTransitions: t.PhaseTransitions,
+	}
+	if !b.Status.StartTimestamp.IsZero() {
+		start := b.Status.StartTimestamp.Time
+		s.StartedAt = &start
+	}
+	if b.Status.CompletionTimestamp != nil && !b.Status.CompletionTimestamp.IsZero() {
+		complete := b.Status.CompletionTimestamp.Time
+		s.CompletedAt = &complete
+	}
+	if s.StartedAt != nil && s.CompletedAt != nil {
+		s.DurationMs = s.CompletedAt.Sub(*s.StartedAt).Milliseconds()
+	}
+	if b.Spec.Output.To != nil {
+		s.PushTarget = b.Spec.Output.To.Name
+	}
+	if from := buildSourceImage(b); len(from) > 0 {
+		s.PullTarget = from
+	}
+	return s
+}
+
+// buildSourceImage finds the "from" image reference for whichever build strategy is
+// in use, for the summary's pullTarget field.
+func buildSourceImage(b *buildv1.Build) string {
+	switch {
+	case b.Spec.Strategy.SourceStrategy != nil && b.Spec.Strategy.SourceStrategy.From.Name != "":
+		return b.Spec.Strategy.SourceStrategy.From.Name
+	case b.Spec.Strategy.DockerStrategy != nil && b.Spec.Strategy.DockerStrategy.From != nil:
+		return b.Spec.Strategy.DockerStrategy.From.Name
+	case b.Spec.Strategy.CustomStrategy != nil && b.Spec.Strategy.CustomStrategy.From.Name != "":
+		return b.Spec.Strategy.CustomStrategy.From.Name
+	}
+	return ""
+}
+
+// buildPodName mirrors the naming convention the build controller uses for the pod it
+// creates to run a build, "<name>-build" (see naming.GetPodName(name, "build") in the
+// build controller).
+func buildPodName(b *buildv1.Build) string {
+	return b.Name + "-build"
+}
+
+func (t *BuildResult) mergedEvents(podName string) []mergedEvent {
+	var merged []mergedEvent
+	scheme, _ := apitesting.SchemeForOrDie(buildv1.Install)
+	if events, err := t.Oc.AdminKubeClient().CoreV1().Events(t.Oc.Namespace()).Search(scheme, t.Build); err == nil {
+		for _, event := range events.Items {
+			merged = append(merged, mergedEvent{Time: event.LastTimestamp.Time, Source: "build/" + t.BuildName, Reason: event.Reason, Message: event.Message})
+		}
+	}
+	if pod, err := t.Oc.AdminKubeClient().CoreV1().Pods(t.Oc.Namespace()).Get(podName, metav1.GetOptions{}); err == nil {
+		if events, err := t.Oc.AdminKubeClient().CoreV1().Events(t.Oc.Namespace()).Search(scheme, pod); err == nil {
+			for _, event := range events.Items {
+				merged = append(merged, mergedEvent{Time: event.LastTimestamp.Time, Source: "pod/" + podName, Reason: event.Reason, Message: event.Message})
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Time.Before(merged[j].Time) })
+	return merged
+}
+
+func formatMergedEvents(events []mergedEvent) string {
+	out := ""
+	for _, e := range events {
+		out += fmt.Sprintf("%s  %-20s  %-20s  %s\n", e.Time.Format(time.RFC3339), e.Source, e.Reason, e.Message)
+	}
+	return out
+}
+
+// dumpRegistryLogsToString returns the openshift-image-registry deployment's log since
+// the build was created (or for the last hour, if the build's creation time is
+// unknown) instead of writing it straight to the Ginkgo writer, so it can also be
+// captured as an artifact. Unlike dumpRegistryLogs, it does not read the
+// default/docker-registry log.
+func (t *BuildResult) dumpRegistryLogsToString() (string, error) {
+	since := buildLogsSince(t)
+	savedNamespace := t.Oc.Namespace()
+	defer t.Oc.SetNamespace(savedNamespace)
+
+	out := ""
+	oadm := t.Oc.AsAdmin().SetNamespace("openshift-image-registry")
+	regOut, err := oadm.Run("logs").Args("deployment/image-registry", "--since="+since.String()).Output()
+	if err == nil {
+		out += regOut
+	}
+	return out, nil
+}
+
+func buildLogsSince(t *BuildResult) time.Duration {
+	if t.Build != nil && !t.Build.CreationTimestamp.IsZero() {
+		return time.Now().Sub(t.Build.CreationTimestamp.Time)
+	}
+	return time.Hour
+}
+
+// junitTestCase and junitTestSuite are a minimal JUnit XML document, enough for CI
+// systems that surface junit/*.xml to link failures back to collected artifacts via
+// the system-out block.
+type junitTestCase struct {
+	XMLName   xml.Name `xml:"testcase"`
+	Name      string   `xml:"name,attr"`
+	ClassName string   `xml:"classname,attr"`
+	Time      string   `xml:"time,attr"`
+	Failure   *string  `xml:"failure,omitempty"`
+	SystemOut string   `xml:"system-out"`
+}
+
+type junitTestSuite struct {
+	XMLName xml.Name        `xml:"testsuite"`
+	Name    string          `xml:"name,attr"`
+	Tests   int             `xml:"tests,attr"`
+	Cases   []junitTestCase `xml:"testcase"`
+}
+
+// WriteBuildJUnit writes a single-testcase JUnit XML file at junit/build-<name>.xml
+// inside the shared DumpCollector's bundle, referencing the artifact paths CollectArtifacts
+// returned, so CI can surface a build failure with direct links to its logs.
+func (t *BuildResult) WriteBuildJUnit(artifactPaths []string) error {
+	collector := defaultDumpCollector()
+	if !collector.Enabled() || t == nil {
+		return nil
+	}
+	systemOut := "collected artifacts:\n"
+	for _, p := range artifactPaths {
+		systemOut += "  " + p + "\n"
+	}
+	tc := junitTestCase{
+		Name:      t.BuildName,
+		ClassName: "builds",
+		Time:      fmt.Sprintf("%.3f", buildDurationSeconds(t)),
+		SystemOut: systemOut,
+	}
+	if t.BuildFailure || t.BuildTimeout {
+		msg := fmt.Sprintf("build %s did not succeed: success=%v failure=%v cancelled=%v timeout=%v", t.BuildName, t.BuildSuccess, t.BuildFailure, t.BuildCancelled, t.BuildTimeout)
+		tc.Failure = &msg
+	}
+	suite := junitTestSuite{Name: "builds", Tests: 1, Cases: []junitTestCase{tc}}
+	b, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	collector.AddRaw(filepath.Join("junit", "build-"+t.BuildName+".xml"), "JUnit result for build "+t.BuildName, b)
+	return nil
+}
+
+func buildDurationSeconds(t *BuildResult) float64 {
+	if t.Build == nil || t.Build.Status.StartTimestamp.IsZero() || t.Build.Status.CompletionTimestamp == nil {
+		return 0
+	}
+	return t.Build.Status.CompletionTimestamp.Sub(t.Build.Status.StartTimestamp.Time).Seconds()
+}
+
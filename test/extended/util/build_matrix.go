@@ -0,0 +1,77 @@
+package util
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/extensions/table"
+	o "github.com/onsi/gomega"
+)
+
+// SampleRepoConfig describes one sample-repo build/deploy/probe scenario for
+// BuildMatrix: a repo to build, the strategy and target imagestream to build with,
+// and the output an HTTP probe against the resulting deployment should see.
+type SampleRepoConfig struct {
+	// Name is used both in the generated Ginkgo entry description and as the
+	// buildconfig/deploymentconfig name.
+	Name string
+	// RepoURL is the git repository to build.
+	RepoURL string
+	// Strategy is the build strategy start-build should use ("source", "docker", ...).
+	Strategy string
+	// ImageStream names the target imagestream tag for the build output. BuildMatrix
+	// does not read it; the build's output goes wherever the existing buildconfig
+	// named Name sends it.
+	ImageStream string
+	// Path is the HTTP path to probe once the deployment is available.
+	Path string
+	// ExpectedOutput is matched against the HTTP probe response body.
+	ExpectedOutput string
+	// Focus marks this entry ginkgo-focused.
+	Focus bool
+	// Pending marks this entry ginkgo-pending.
+	Pending bool
+}
+
+// BuildMatrix generates a ginkgo/extensions/table DescribeTable entry for each
+// SampleRepoConfig: it starts a build from the repo, waits for the resulting
+// deploymentconfig to roll out, and probes it over HTTP. This collapses the
+// hand-written Describe/It duplication across sample-repo tests into one table, so
+// adding a new language runtime is a one-line table.Entry append. Call it from inside
+// a Ginkgo Describe block, the same place a hand-written Describe/It pair would go.
+func BuildMatrix(oc *CLI, configs []SampleRepoConfig) {
+	table.DescribeTable("sample repository",
+		func(cfg SampleRepoConfig) {
+			result, err := StartBuildAndWait(oc, cfg.Name, "--from-repo", cfg.RepoURL, "--strategy", cfg.Strategy, "--wait")
+			o.Expect(err).NotTo(o.HaveOccurred())
+			result.AssertSuccess()
+
+			err = WaitForDeploymentConfig(oc.KubeClient(), oc.AppsClient().AppsV1(), oc.Namespace(), cfg.Name, 1, true, oc)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			address, err := GetEndpointAddress(oc, cfg.Name)
+			o.Expect(err).NotTo(o.HaveOccurred())
+
+			response, err := FetchURL(oc, fmt.Sprintf("http://%s%s", address, cfg.Path), 2*time.Minute)
+			o.Expect(err).NotTo(o.HaveOccurred())
+			o.Expect(response).To(o.ContainSubstring(cfg.ExpectedOutput))
+		},
+		buildMatrixEntries(configs)...,
+	)
+}
+
+func buildMatrixEntries(configs []SampleRepoConfig) []table.TableEntry {
+	entries := make([]table.TableEntry, 0, len(configs))
+	for _, cfg := range configs {
+		description := fmt.Sprintf("building and probing %s from %s", cfg.Name, cfg.RepoURL)
+		switch {
+		case cfg.Focus:
+			entries = append(entries, table.FEntry(description, cfg))
+		case cfg.Pending:
+			entries = append(entries, table.PEntry(description, cfg))
+		default:
+			entries = append(entries, table.Entry(description, cfg))
+		}
+	}
+	return entries
+}
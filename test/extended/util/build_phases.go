@@ -0,0 +1,72 @@
+package util
+
+import (
+	"time"
+
+	buildv1 "github.com/openshift/api/build/v1"
+)
+
+// PhaseTransition records a single observed build phase change, for diagnosing how
+// long a build spent in each phase of its lifecycle. The Build API does not itself
+// timestamp individual phase changes, so Timestamp is Status.StartTimestamp for the
+// first transition (or the time it was observed, if StartTimestamp is not yet set) and
+// the time it was observed by WaitForBuildResult for every transition after that.
+type PhaseTransition struct {
+	Phase     buildv1.BuildPhase
+	Timestamp time.Time
+	Reason    buildv1.StatusReason
+	Message   string
+}
+
+// recordPhaseTransition appends a PhaseTransition if b's phase differs from the last
+// one recorded (or none has been recorded yet). It is a no-op otherwise, since
+// WaitForBuildResult's predicates are invoked on every observed Build update, not just
+// on phase changes.
+func (t *BuildResult) recordPhaseTransition(b *buildv1.Build) {
+	if len(t.PhaseTransitions) > 0 && t.PhaseTransitions[len(t.PhaseTransitions)-1].Phase == b.Status.Phase {
+		return
+	}
+	timestamp := time.Now()
+	if len(t.PhaseTransitions) == 0 && !b.Status.StartTimestamp.IsZero() {
+		timestamp = b.Status.StartTimestamp.Time
+	}
+	t.PhaseTransitions = append(t.PhaseTransitions, PhaseTransition{
+		Phase:     b.Status.Phase,
+		Timestamp: timestamp,
+		Reason:    b.Status.Reason,
+		Message:   b.Status.Message,
+	})
+}
+
+// TimeInPhase returns how long the build spent in the given phase, based on recorded
+// PhaseTransitions. The open-ended final transition is bounded by
+// Status.CompletionTimestamp if the build has finished, or by time.Now otherwise. It
+// returns 0 if the phase was never observed.
+func (t *BuildResult) TimeInPhase(phase buildv1.BuildPhase) time.Duration {
+	var total time.Duration
+	for i, transition := range t.PhaseTransitions {
+		if transition.Phase != phase {
+			continue
+		}
+		end := time.Now()
+		if i+1 < len(t.PhaseTransitions) {
+			end = t.PhaseTransitions[i+1].Timestamp
+		} else if t.Build != nil && t.Build.Status.CompletionTimestamp != nil {
+			end = t.Build.Status.CompletionTimestamp.Time
+		}
+		total += end.Sub(transition.Timestamp)
+	}
+	return total
+}
+
+// FirstTransitionTo returns the time the build first entered the given phase, or nil
+// if it was never observed.
+func (t *BuildResult) FirstTransitionTo(phase buildv1.BuildPhase) *time.Time {
+	for _, transition := range t.PhaseTransitions {
+		if transition.Phase == phase {
+			timestamp := transition.Timestamp
+			return &timestamp
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	buildv1 "github.com/openshift/api/build/v1"
+	buildv1clienttyped "github.com/openshift/client-go/build/clientset/versioned/typed/build/v1"
+)
+
+// buildWaiter is a single build-name + predicate registration held by a BuildWatcher.
+type buildWaiter struct {
+	isOK, isFailed, isCanceled func(*buildv1.Build) bool
+	result                     chan error
+	done                       bool
+}
+
+// BuildWatcher maintains a single watch connection against the Builds API for a
+// namespace and dispatches every observed Build to any number of registered
+// build-name + predicate waiters. This replaces having each caller run its own
+// independent wait.Poll loop every 5 seconds: tests that launch dozens of parallel
+// builds share one watch instead of hammering the apiserver with one poller per
+// build, and waiters are no longer bound by the poll interval.
+type BuildWatcher struct {
+	client buildv1clienttyped.BuildInterface
+
+	mu      sync.Mutex
+	waiters map[string][]*buildWaiter
+}
+
+// NewBuildWatcher returns a BuildWatcher for the given Build client. Register waiters
+// with Register, then start dispatching events with Run.
+func NewBuildWatcher(client buildv1clienttyped.BuildInterface) *BuildWatcher {
+	return &BuildWatcher{client: client, waiters: map[string][]*buildWaiter{}}
+}
+
+// Register adds a build-name + predicate waiter and returns a channel that receives
+// exactly one value once the Build matches isOK, isFailed, or isCanceled: nil if it
+// matched isOK or isCanceled, or an error naming the build's phase if it matched
+// isFailed. A nil predicate falls
+// back to the corresponding Check* helper, matching WaitForABuild's historical
+// defaults. Register may be called before or after Run.
+func (w *BuildWatcher) Register(name string, isOK, isFailed, isCanceled func(*buildv1.Build) bool) <-chan error {
+	if isOK == nil {
+		isOK = CheckBuildSuccess
+	}
+	if isFailed == nil {
+		isFailed = CheckBuildFailed
+	}
+	if isCanceled == nil {
+		isCanceled = CheckBuildCancelled
+	}
+	bw := &buildWaiter{isOK: isOK, isFailed: isFailed, isCanceled: isCanceled, result: make(chan error, 1)}
+	w.mu.Lock()
+	w.waiters[name] = append(w.waiters[name], bw)
+	w.mu.Unlock()
+	return bw.result
+}
+
+func (w *BuildWatcher) dispatch(b *buildv1.Build) {
+	w.mu.Lock()
+	waiters := append([]*buildWaiter{}, w.waiters[b.Name]...)
+	w.mu.Unlock()
+	for _, bw := range waiters {
+		if bw.done {
+			continue
+		}
+		switch {
+		case bw.isOK(b) || bw.isCanceled(b):
+			bw.done = true
+			bw.result <- nil
+		case bw.isFailed(b):
+			bw.done = true
+			bw.result <- fmt.Errorf("The build %q status is %q", b.Name, b.Status.Phase)
+		}
+	}
+}
+
+// Run lists and then watches Builds in the configured namespace until ctx is done,
+// dispatching every observed Build to registered waiters. On watch-channel closure it
+// re-lists and re-watches from the latest resourceVersion, the same idiom already used
+// by WaitForAnImageStream.
+func (w *BuildWatcher) Run(ctx context.Context) error {
+	for {
+		list, err := w.client.List(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range list.Items {
+			w.dispatch(&list.Items[i])
+		}
+
+		watcher, err := w.client.Watch(metav1.ListOptions{ResourceVersion: list.ResourceVersion})
+		if err != nil {
+			return err
+		}
+
+		closed := false
+		for !closed {
+			select {
+			case <-ctx.Done():
+				watcher.Stop()
+				return ctx.Err()
+			case evt, ok := <-watcher.ResultChan():
+				if !ok {
+					closed = true
+					continue
+				}
+				if b, ok := evt.Object.(*buildv1.Build); ok {
+					w.dispatch(b)
+				}
+			}
+		}
+		watcher.Stop()
+	}
+}
+
+// WaitForABuild waits for a Build object to match either isOK or isFailed conditions.
+// It starts a BuildWatcher scoped to this single call; callers waiting on many builds
+// in the same namespace concurrently should share a BuildWatcher directly via
+// NewBuildWatcher/Register/Run instead, to avoid one watch connection per build.
+//
+// Being watch- rather than poll-based, WaitForABuild has no natural "recheck interval";
+// PollInterval instead sets how often it logs a still-waiting heartbeat via Logf (0
+// disables the heartbeat), so WithPollInterval/WithLogger remain meaningful here rather
+// than silently doing nothing.
+func WaitForABuild(c buildv1clienttyped.BuildInterface, name string, isOK, isFailed, isCanceled func(*buildv1.Build) bool, opts ...WaitOption) error {
+	o := resolveWaitOptions(12*time.Minute, 30*time.Second, opts...)
+
+	watcher := NewBuildWatcher(c)
+	resultCh := watcher.Register(name, isOK, isFailed, isCanceled)
+
+	ctx, cancel := context.WithTimeout(o.Context, o.Timeout)
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- watcher.Run(ctx) }()
+
+	o.Logf("Waiting for build %q to complete", name)
+
+	var heartbeat <-chan time.Time
+	if o.PollInterval > 0 {
+		ticker := time.NewTicker(o.PollInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-resultCh:
+			return err
+		case err := <-runErr:
+			if err == context.DeadlineExceeded {
+				return fmt.Errorf("Timed out waiting for build %q to complete", name)
+			}
+			return err
+		case <-heartbeat:
+			o.Logf("Still waiting for build %q to complete", name)
+		}
+	}
+}
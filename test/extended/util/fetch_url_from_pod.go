@@ -0,0 +1,93 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+)
+
+// ephemeralContainersSupported reports whether the apiserver advertises the
+// pods/ephemeralcontainers subresource, the same check "kubectl debug" makes before
+// attempting to attach a debug container to a running pod.
+func ephemeralContainersSupported(oc *CLI) bool {
+	resources, err := oc.AdminKubeClient().Discovery().ServerResourcesForGroupVersion("v1")
+	if err != nil {
+		return false
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name == "pods/ephemeralcontainers" {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchURLFromPod grabs the output of curl against url, run from inside targetPod's
+// network and mount namespaces, and returns it. On clusters that advertise the
+// pods/ephemeralcontainers subresource, it attaches a short-lived debug container to
+// targetPod's first container and execs curl in it via SPDY, avoiding the cost of
+// spinning up a scratch exec pod for every probe and letting tests reach headless
+// services, sidecar-only endpoints, and localhost ports that a separate pod could not.
+// On older clusters it falls back to FetchURL's exec-pod behavior.
+func FetchURLFromPod(oc *CLI, targetPod, url string, timeout time.Duration) (string, error) {
+	if !ephemeralContainersSupported(oc) {
+		return FetchURL(oc, url, timeout)
+	}
+
+	pods := oc.AdminKubeClient().CoreV1().Pods(oc.Namespace())
+	pod, err := pods.Get(targetPod, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return "", fmt.Errorf("pod %s has no containers to target", targetPod)
+	}
+
+	containerName := "fetch-url-debugger"
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:  containerName,
+			Image: "curlimages/curl",
+			// Sleep so the container survives long enough to be exec'd into; curl itself
+			// runs via StreamingExecutor.Output below, not as the container's entrypoint.
+			Command: []string{"sleep", fmt.Sprintf("%d", int(timeout.Seconds())+30)},
+		},
+		TargetContainerName: pod.Spec.Containers[0].Name,
+	})
+	if _, err := pods.UpdateEphemeralContainers(targetPod, pod); err != nil {
+		e2e.Logf("Could not add ephemeral container to pod %s, falling back to exec pod: %v", targetPod, err)
+		return FetchURL(oc, url, timeout)
+	}
+
+	if err := waitForEphemeralContainerRunning(oc, targetPod, containerName, timeout); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return NewStreamingExecutor(oc, targetPod).Output(ctx, containerName, []string{"curl", "-vvv", url})
+}
+
+// waitForEphemeralContainerRunning waits for the kubelet to report the named ephemeral
+// container as started, via the EphemeralContainerStatuses the kubelet writes back to
+// the pod (we only add the container spec-side above; its status is not ours to set).
+func waitForEphemeralContainerRunning(oc *CLI, podName, containerName string, timeout time.Duration) error {
+	return wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		pod, err := oc.AdminKubeClient().CoreV1().Pods(oc.Namespace()).Get(podName, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name == containerName {
+				return status.State.Running != nil || status.State.Terminated != nil, nil
+			}
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,110 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imagev1 "github.com/openshift/api/image/v1"
+	imagev1typedclient "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+)
+
+// imageStreamWaiter is a single stream-name + predicate registration held by an
+// ImageStreamWatcher.
+type imageStreamWaiter struct {
+	isOK, isFailed func(*imagev1.ImageStream) bool
+	result         chan error
+	done           bool
+}
+
+// ImageStreamWatcher maintains a single watch connection against the ImageStreams API
+// for a namespace and dispatches every observed ImageStream to any number of registered
+// name + predicate waiters, mirroring BuildWatcher. This replaces
+// WaitForAnImageStream's historical per-call list/watch/reget loop scoped by a
+// metadata.name field selector, so callers waiting on many image streams in the same
+// namespace share one watch instead of one connection per stream.
+type ImageStreamWatcher struct {
+	client imagev1typedclient.ImageStreamInterface
+
+	mu      sync.Mutex
+	waiters map[string][]*imageStreamWaiter
+}
+
+// NewImageStreamWatcher returns an ImageStreamWatcher for the given ImageStream client.
+// Register waiters with Register, then start dispatching events with Run.
+func NewImageStreamWatcher(client imagev1typedclient.ImageStreamInterface) *ImageStreamWatcher {
+	return &ImageStreamWatcher{client: client, waiters: map[string][]*imageStreamWaiter{}}
+}
+
+// Register adds a stream-name + predicate waiter and returns a channel that receives
+// exactly one value (nil on success, or an error describing why the stream did not
+// succeed) once the ImageStream matches isOK or isFailed. Register may be called before
+// or after Run.
+func (w *ImageStreamWatcher) Register(name string, isOK, isFailed func(*imagev1.ImageStream) bool) <-chan error {
+	isw := &imageStreamWaiter{isOK: isOK, isFailed: isFailed, result: make(chan error, 1)}
+	w.mu.Lock()
+	w.waiters[name] = append(w.waiters[name], isw)
+	w.mu.Unlock()
+	return isw.result
+}
+
+func (w *ImageStreamWatcher) dispatch(is *imagev1.ImageStream) {
+	w.mu.Lock()
+	waiters := append([]*imageStreamWaiter{}, w.waiters[is.Name]...)
+	w.mu.Unlock()
+	for _, isw := range waiters {
+		if isw.done {
+			continue
+		}
+		switch {
+		case isw.isOK(is):
+			isw.done = true
+			isw.result <- nil
+		case isw.isFailed(is):
+			isw.done = true
+			isw.result <- fmt.Errorf("The image stream %q status is %q",
+				is.Name, is.Annotations[imagev1.DockerImageRepositoryCheckAnnotation])
+		}
+	}
+}
+
+// Run lists and then watches ImageStreams in the configured namespace until ctx is
+// done, dispatching every observed ImageStream to registered waiters. On
+// watch-channel closure it re-lists and re-watches from the latest resourceVersion,
+// the same idiom BuildWatcher.Run uses.
+func (w *ImageStreamWatcher) Run(ctx context.Context) error {
+	for {
+		list, err := w.client.List(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range list.Items {
+			w.dispatch(&list.Items[i])
+		}
+
+		watcher, err := w.client.Watch(metav1.ListOptions{ResourceVersion: list.ResourceVersion})
+		if err != nil {
+			return err
+		}
+
+		closed := false
+		for !closed {
+			select {
+			case <-ctx.Done():
+				watcher.Stop()
+				return ctx.Err()
+			case evt, ok := <-watcher.ResultChan():
+				if !ok {
+					closed = true
+					continue
+				}
+				if is, ok := evt.Object.(*imagev1.ImageStream); ok {
+					w.dispatch(is)
+				}
+			}
+		}
+		watcher.Stop()
+	}
+}
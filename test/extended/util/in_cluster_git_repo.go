@@ -0,0 +1,188 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+
+	"github.com/openshift/library-go/pkg/git"
+)
+
+// gitServerImage runs plain "git daemon", serving the bare repositories under /srv/git
+// that carry a git-daemon-export-ok marker over the git:// protocol with no
+// authentication, which is enough for
+// test fixtures that just need something a BuildConfig or Pipeline can clone from
+// inside the cluster.
+const gitServerImage = "registry.access.redhat.com/ubi8/ubi-minimal"
+const gitServerPort = 9418
+
+// NewInClusterGitRepo deploys a single-pod git daemon plus a matching Service into
+// oc's namespace, initializes name.git as an empty bare repository inside it, and
+// clones a local working copy through a port-forward so AddAndCommit can use ordinary
+// git operations. The returned GitRepo's upstreamPath is the in-cluster URL a
+// BuildConfig or Pipeline can clone from (e.g. "git://git-server.<ns>.svc:9418/<name>.git");
+// use LocalURL instead for local git commands, since upstreamPath is only reachable
+// from inside the cluster.
+func NewInClusterGitRepo(oc *CLI, name string) (GitRepo, error) {
+	podName := "git-server"
+	serviceName := "git-server"
+	repoPathInPod := "/srv/git/" + name + ".git"
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   podName,
+			Labels: map[string]string{"name": podName},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "git-daemon",
+					Image:   gitServerImage,
+					Command: []string{"/bin/sh", "-c"},
+					Args: []string{fmt.Sprintf(
+						// git daemon refuses receive-pack (i.e. "git push") by default, so
+						// AddAndCommit/pushToCluster's pushes would otherwise be rejected after
+						// the first clone. Rather than passing the global --enable=receive-pack
+						// (which would accept pushes to any repo under --base-path), mark only
+						// this one repo exportable and push-able via its own config, and drop
+						// --export-all now that the repo carries its own export-ok marker.
+						"microdnf install -y git >/dev/null 2>&1; mkdir -p %s && git init --bare %s && touch %s/git-daemon-export-ok && git config --file %s/config daemon.receivepack true && exec git daemon --verbose --reuseaddr --base-path=/srv/git --port=%d /srv/git",
+						repoPathInPod, repoPathInPod, repoPathInPod, repoPathInPod, gitServerPort,
+					)},
+					Ports: []corev1.ContainerPort{{ContainerPort: gitServerPort}},
+				},
+			},
+		},
+	}
+	if _, err := oc.AdminKubeClient().CoreV1().Pods(oc.Namespace()).Create(pod); err != nil {
+		return GitRepo{}, fmt.Errorf("error creating git server pod: %v", err)
+	}
+	if _, err := WaitForPods(oc.KubeClient().CoreV1().Pods(oc.Namespace()), ParseLabelsOrDie("name="+podName), CheckPodIsReady, 1, 3*time.Minute); err != nil {
+		return GitRepo{}, fmt.Errorf("git server pod never became ready: %v", err)
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: serviceName},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"name": podName},
+			Ports: []corev1.ServicePort{
+				{Port: gitServerPort, TargetPort: intstr.FromInt(gitServerPort)},
+			},
+		},
+	}
+	if _, err := oc.AdminKubeClient().CoreV1().Services(oc.Namespace()).Create(service); err != nil {
+		return GitRepo{}, fmt.Errorf("error creating git server service: %v", err)
+	}
+
+	testDir, err := ioutil.TempDir("", name)
+	if err != nil {
+		return GitRepo{}, err
+	}
+
+	repoInfo := GitRepo{
+		baseTempDir:  testDir,
+		upstreamPath: fmt.Sprintf("git://%s.%s.svc:%d/%s.git", serviceName, oc.Namespace(), gitServerPort, name),
+		RepoPath:     testDir + "/" + name,
+		oc:           oc,
+		podName:      podName,
+		serviceName:  serviceName,
+		repoName:     name,
+	}
+
+	localURL, closePortForward, err := repoInfo.LocalURL()
+	if err != nil {
+		return GitRepo{baseTempDir: testDir}, err
+	}
+	defer closePortForward()
+
+	if err := wait.PollImmediate(2*time.Second, 2*time.Minute, func() (bool, error) {
+		return exec.Command("git", "ls-remote", localURL).Run() == nil, nil
+	}); err != nil {
+		return GitRepo{baseTempDir: testDir}, fmt.Errorf("git server never became ready: %v", err)
+	}
+
+	repo := git.NewRepository()
+	if err := repo.Clone(repoInfo.RepoPath, localURL); err != nil {
+		return GitRepo{baseTempDir: testDir}, fmt.Errorf("error cloning in-cluster repo: %v", err)
+	}
+	repoInfo.repo = repo
+
+	return repoInfo, nil
+}
+
+// pushToCluster pushes the local repo clone up to the in-cluster git server through a
+// temporary port-forward, for GitRepos created by NewInClusterGitRepo.
+func (r GitRepo) pushToCluster() error {
+	localURL, closePortForward, err := r.LocalURL()
+	if err != nil {
+		return err
+	}
+	defer closePortForward()
+
+	cmd := exec.Command("git", "push", localURL, "master")
+	cmd.Dir = r.RepoPath
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error pushing to in-cluster git server: %v: %s", err, out)
+	}
+	return nil
+}
+
+// LocalURL opens a port-forward from the local machine to the in-cluster git server
+// and returns a git:// URL through it, along with a func that must be called (for
+// example via defer) once the caller is done using the URL.
+func (r GitRepo) LocalURL() (string, func(), error) {
+	localPort, stopCh, err := r.portForward(gitServerPort)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("git://localhost:%d/%s.git", localPort, r.repoName), func() { close(stopCh) }, nil
+}
+
+func (r GitRepo) portForward(remotePort int) (int, chan struct{}, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(r.oc.AdminConfig())
+	if err != nil {
+		return 0, nil, err
+	}
+	req := r.oc.AdminKubeClient().CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(r.oc.Namespace()).
+		Name(r.podName).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+
+	readyCh := make(chan struct{})
+	stopCh := make(chan struct{})
+	pf, err := portforward.New(dialer, []string{fmt.Sprintf("0:%d", remotePort)}, stopCh, readyCh, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- pf.ForwardPorts() }()
+
+	select {
+	case <-readyCh:
+	case err := <-errCh:
+		return 0, nil, err
+	case <-time.After(30 * time.Second):
+		close(stopCh)
+		return 0, nil, fmt.Errorf("timed out waiting for port-forward to pod %s to become ready", r.podName)
+	}
+
+	ports, err := pf.GetPorts()
+	if err != nil {
+		close(stopCh)
+		return 0, nil, err
+	}
+	return int(ports[0].Local), stopCh, nil
+}
@@ -0,0 +1,270 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// JobRunnerOptions configures the Job a JobRunner submits: retry/backoff limits, an
+// overall deadline enforced by the apiserver itself, resource requests/limits for the
+// command container, and any image-pull secrets it needs.
+type JobRunnerOptions struct {
+	BackoffLimit          *int32
+	ActiveDeadlineSeconds *int64
+	Resources             corev1.ResourceRequirements
+	ImagePullSecrets      []corev1.LocalObjectReference
+}
+
+// JobRunner runs a single command to completion as a batchv1.Job. It replaces
+// RunOneShotCommandPod's separate wait.PollImmediate loops for pod status and log
+// retrieval with one informer-driven wait for the Job's own Complete/Failed
+// conditions, and follows the pod's logs into a writer as they're produced instead of
+// fetching them only once the pod has already finished. Terminal state comes from the
+// Job's conditions rather than from string-matching container termination reasons, so
+// it correctly reports OOMKilled pods and non-zero exit codes as failures too.
+type JobRunner struct {
+	client  kubernetes.Interface
+	options JobRunnerOptions
+}
+
+// NewJobRunner returns a JobRunner backed by the given clientset.
+func NewJobRunner(client kubernetes.Interface, options JobRunnerOptions) *JobRunner {
+	return &JobRunner{client: client, options: options}
+}
+
+// Run submits a Job named name running command in image and waits up to timeout for it
+// to reach a terminal condition. If out is non-nil, logs are streamed into it as
+// they're produced and Run's string result is empty; otherwise logs are buffered and
+// returned as that result, preserving RunOneShotCommandPod's historical signature.
+func (r *JobRunner) Run(
+	oc *CLI,
+	name, image, command string,
+	volumeMounts []corev1.VolumeMount,
+	volumes []corev1.Volume,
+	env []corev1.EnvVar,
+	out io.Writer,
+	timeout time.Duration,
+) (string, []error) {
+	namespace := oc.Namespace()
+	cmd := strings.Split(command, " ")
+
+	job, err := r.client.BatchV1().Jobs(namespace).Create(r.newJob(name, image, cmd[0], cmd[1:], volumeMounts, volumes, env))
+	if err != nil {
+		return "", []error{fmt.Errorf("error creating job %q: %v", name, err)}
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(r.client, 30*time.Second, informers.WithNamespace(namespace))
+	jobInformer := factory.Batch().V1().Jobs().Informer()
+	podInformer := factory.Core().V1().Pods().Informer()
+
+	var buf bytes.Buffer
+	writer := out
+	if writer == nil {
+		writer = &buf
+	}
+
+	var streamOnce sync.Once
+	var streamWG sync.WaitGroup
+	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { r.maybeStreamLogs(obj, job, writer, &streamOnce, &streamWG) },
+		UpdateFunc: func(_, obj interface{}) { r.maybeStreamLogs(obj, job, writer, &streamOnce, &streamWG) },
+	})
+
+	done := make(chan *batchv1.Job, 1)
+	onJobEvent := func(obj interface{}) {
+		j, ok := obj.(*batchv1.Job)
+		if !ok || j.Name != job.Name {
+			return
+		}
+		if jobCondition(j, batchv1.JobComplete) != nil || jobCondition(j, batchv1.JobFailed) != nil {
+			select {
+			case done <- j:
+			default:
+			}
+		}
+	}
+	jobInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    onJobEvent,
+		UpdateFunc: func(_, obj interface{}) { onJobEvent(obj) },
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+
+	var errs []error
+	select {
+	case finished := <-done:
+		if cond := jobCondition(finished, batchv1.JobFailed); cond != nil {
+			errs = append(errs, fmt.Errorf("job %s failed: %s: %s", name, cond.Reason, cond.Message))
+		}
+	case <-time.After(timeout):
+		errs = append(errs, fmt.Errorf("timed out after %s waiting for job %s to complete", timeout, name))
+	}
+
+	// Wait for followLogs to drain before reading buf: without this, buf.String() below
+	// could run concurrently with (or before) the followLogs goroutine's writes to it,
+	// both racing on the buffer and truncating the returned log.
+	streamWG.Wait()
+
+	if out != nil {
+		return "", errs
+	}
+	return buf.String(), errs
+}
+
+func (r *JobRunner) newJob(name, image, command string, args []string, volumeMounts []corev1.VolumeMount, volumes []corev1.Volume, env []corev1.EnvVar) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          r.options.BackoffLimit,
+			ActiveDeadlineSeconds: r.options.ActiveDeadlineSeconds,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec: corev1.PodSpec{
+					RestartPolicy:    corev1.RestartPolicyNever,
+					Volumes:          volumes,
+					ImagePullSecrets: r.options.ImagePullSecrets,
+					Containers: []corev1.Container{
+						{
+							Name:            name,
+							Image:           image,
+							Command:         []string{command},
+							Args:            args,
+							VolumeMounts:    volumeMounts,
+							ImagePullPolicy: corev1.PullAlways,
+							Env:             env,
+							Resources:       r.options.Resources,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// jobCondition returns job's condition of the given type if it is currently true.
+func jobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return condition
+		}
+	}
+	return nil
+}
+
+// maybeStreamLogs starts following obj's logs into out, exactly once, once obj is
+// observed to be the Job's pod and to have started. wg is marked done once followLogs
+// returns, so Run can wait for out to be fully written before reading it back.
+func (r *JobRunner) maybeStreamLogs(obj interface{}, job *batchv1.Job, out io.Writer, once *sync.Once, wg *sync.WaitGroup) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Labels["job-name"] != job.Name {
+		return
+	}
+	if pod.Status.Phase == corev1.PodPending {
+		return
+	}
+	once.Do(func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.followLogs(pod.Namespace, pod.Name, out)
+		}()
+	})
+}
+
+// followLogs copies the pod's logs into out in follow mode, reconnecting with
+// exponential backoff (capped at 30s) if the stream drops with a transient error, such
+// as io.ErrUnexpectedEOF or a 5xx from the apiserver. Each reconnect passes SinceTime
+// set to the timestamp of the last line copied, so it resumes the stream instead of
+// replaying the whole log into out again; PodLogOptions.SinceTime only has second
+// resolution, so lines logged in the same second as the last one copied may be
+// copied again, which is a minor cost next to re-copying everything seen so far.
+func (r *JobRunner) followLogs(namespace, podName string, out io.Writer) {
+	backoff := time.Second
+	var sinceTime *metav1.Time
+	for {
+		opts := &corev1.PodLogOptions{Follow: true, Timestamps: true}
+		if sinceTime != nil {
+			opts.SinceTime = sinceTime
+		}
+		stream, err := r.client.CoreV1().Pods(namespace).GetLogs(podName, opts).Stream()
+		if err != nil {
+			if !isTransientLogError(err) {
+				return
+			}
+		} else {
+			copyErr := copyTimestampedLines(out, stream, &sinceTime)
+			stream.Close()
+			if copyErr == nil || !isTransientLogError(copyErr) {
+				return
+			}
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// copyTimestampedLines copies each line of stream (which has a leading RFC3339Nano
+// timestamp, since followLogs always requests Timestamps: true) to out with that prefix
+// stripped, and advances *sinceTime to the latest one seen so a reconnect can resume
+// from it. A line whose prefix doesn't parse as a timestamp is copied unchanged.
+func copyTimestampedLines(out io.Writer, stream io.Reader, sinceTime **metav1.Time) error {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if ts, rest, ok := splitTimestampPrefix(line); ok {
+			parsed := metav1.NewTime(ts)
+			*sinceTime = &parsed
+			line = rest
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func splitTimestampPrefix(line string) (time.Time, string, bool) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return time.Time{}, line, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return ts, parts[1], true
+}
+
+func isTransientLogError(err error) bool {
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if statusErr, ok := err.(*apierrors.StatusError); ok {
+		return statusErr.Status().Code >= 500
+	}
+	return false
+}
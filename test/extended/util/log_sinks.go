@@ -0,0 +1,166 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+)
+
+// LogSink streams a BuildResult's logs into dest without buffering the whole log into
+// memory, deciding for itself where (if anywhere) to also persist a durable copy. It
+// replaces the single hard-coded "oc logs" invocation Logs/LogsNoTimestamp used to make
+// directly, so a caller running in CI can route build logs to durable storage (a file,
+// an object-store bucket, a log aggregator) without forking this package, and so a
+// multi-hundred-MB build log never has to live in a Go string all at once.
+type LogSink interface {
+	// FetchLogs streams the build's logs into dest. timestamps controls whether
+	// streamed lines are prefixed with their timestamp, mirroring Logs versus
+	// LogsNoTimestamp. It returns a location (a file path, an object-store URL, ...)
+	// describing where a durable copy was written, or "" if this sink doesn't persist
+	// one beyond dest.
+	FetchLogs(t *BuildResult, timestamps bool, dest io.Writer) (location string, err error)
+}
+
+// ocLogsSink is the default LogSink. It streams the build pod's logs directly from the
+// apiserver, the same pod "oc logs build/<name>" resolves to internally, instead of
+// buffering them into a string first.
+type ocLogsSink struct{}
+
+func (ocLogsSink) FetchLogs(t *BuildResult, timestamps bool, dest io.Writer) (string, error) {
+	podName := t.BuildName + "-build"
+	stream, err := t.Oc.AdminKubeClient().CoreV1().Pods(t.Oc.Namespace()).GetLogs(podName, &corev1.PodLogOptions{Timestamps: timestamps}).Stream()
+	if err != nil {
+		return "", fmt.Errorf("Error retrieving logs for %#v: %v", *t, err)
+	}
+	defer stream.Close()
+	if _, err := io.Copy(dest, stream); err != nil {
+		return "", fmt.Errorf("Error streaming logs for %#v: %v", *t, err)
+	}
+	return "", nil
+}
+
+// FileLogSink streams logs from Next (ocLogsSink if Next is nil) straight through to
+// both dest and Dir/<BuildName>.log, so a test run's build logs survive after the
+// cluster used to produce them is gone, without ever holding the full log in memory.
+type FileLogSink struct {
+	Dir  string
+	Next LogSink
+}
+
+func (s FileLogSink) FetchLogs(t *BuildResult, timestamps bool, dest io.Writer) (string, error) {
+	next := s.Next
+	if next == nil {
+		next = ocLogsSink{}
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return "", fmt.Errorf("Error creating log directory %q: %v", s.Dir, err)
+	}
+	path := filepath.Join(s.Dir, t.BuildName+".log")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("Error creating log file %q: %v", path, err)
+	}
+	defer f.Close()
+
+	if _, err := next.FetchLogs(t, timestamps, io.MultiWriter(dest, f)); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Uploader puts a blob of content at a key in some object store and returns a
+// human-readable location for it (e.g. an s3:// or https:// URL). It is satisfied by
+// whatever client the caller already has configured; this package deliberately does not
+// depend on an AWS SDK or any other cloud-vendor client library.
+type Uploader interface {
+	Upload(key string, content []byte) (location string, err error)
+}
+
+// S3LogSink streams logs from Next (ocLogsSink if Next is nil) through to dest, and
+// additionally uploads a copy via Uploader under KeyPrefix/<BuildName>.log. Unlike dest,
+// which never buffers, the copy handed to Uploader is necessarily held in memory first:
+// Uploader.Upload takes a whole blob, not a stream, since this package doesn't want to
+// depend on a specific object-store client's multipart-upload API.
+type S3LogSink struct {
+	Uploader  Uploader
+	KeyPrefix string
+	Next      LogSink
+}
+
+func (s S3LogSink) FetchLogs(t *BuildResult, timestamps bool, dest io.Writer) (string, error) {
+	next := s.Next
+	if next == nil {
+		next = ocLogsSink{}
+	}
+	var buf bytes.Buffer
+	if _, err := next.FetchLogs(t, timestamps, io.MultiWriter(dest, &buf)); err != nil {
+		return "", err
+	}
+	key := filepath.Join(s.KeyPrefix, t.BuildName+".log")
+	location, err := s.Uploader.Upload(key, buf.Bytes())
+	if err != nil {
+		e2e.Logf("Error uploading build log for %s to %s: %v\n", t.BuildName, key, err)
+		return "", nil
+	}
+	e2e.Logf("Uploaded build log for %s to %s\n", t.BuildName, location)
+	return location, nil
+}
+
+// LokiPusher pushes a single log line with a set of labels to a log aggregator. It is
+// satisfied by whatever Loki (or similar) client the caller already has configured.
+type LokiPusher interface {
+	Push(labels map[string]string, line string) error
+}
+
+// LokiLogSink streams logs from Next (ocLogsSink if Next is nil) through to dest, and
+// additionally pushes them, one push per line, to Pusher with Labels plus a "build"
+// label identifying the build. Like S3LogSink, the copy split into lines for Pusher is
+// necessarily buffered first, since Pusher's API is line-oriented rather than streaming.
+type LokiLogSink struct {
+	Pusher LokiPusher
+	Labels map[string]string
+	Next   LogSink
+}
+
+func (s LokiLogSink) FetchLogs(t *BuildResult, timestamps bool, dest io.Writer) (string, error) {
+	next := s.Next
+	if next == nil {
+		next = ocLogsSink{}
+	}
+	var buf bytes.Buffer
+	if _, err := next.FetchLogs(t, timestamps, io.MultiWriter(dest, &buf)); err != nil {
+		return "", err
+	}
+	labels := map[string]string{"build": t.BuildName}
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	for _, line := range splitLines(buf.String()) {
+		if pushErr := s.Pusher.Push(labels, line); pushErr != nil {
+			e2e.Logf("Error pushing build log line for %s to Loki: %v\n", t.BuildName, pushErr)
+			break
+		}
+	}
+	return "", nil
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	start := 0
+	for i, r := range s {
+		if r == '\n' {
+			lines = append(lines, s[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		lines = append(lines, s[start:])
+	}
+	return lines
+}
@@ -0,0 +1,218 @@
+// Package matchers provides Gomega matchers for asserting on a util.BuildResult,
+// for use in place of the BuildResult.AssertSuccess/AssertFailure helpers:
+//
+//	o.Expect(result).To(matchers.HaveSucceeded())
+//	o.Expect(result).To(matchers.HaveBuildPhase(buildv1.BuildPhaseComplete))
+//
+// Unlike AssertSuccess/AssertFailure, these do not dump logs as a side effect of a
+// failed assertion; pair a failing matcher with result.DumpLogs() if that's wanted.
+package matchers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+
+	buildv1 "github.com/openshift/api/build/v1"
+
+	"github.com/openshift/origin/test/extended/util"
+)
+
+// tailLogLines is how many trailing log lines failureDiagnostics includes.
+const tailLogLines = 20
+
+// HaveSucceeded succeeds if the BuildResult's build completed successfully.
+func HaveSucceeded() types.GomegaMatcher {
+	return &buildSuccessMatcher{}
+}
+
+type buildSuccessMatcher struct{}
+
+func (m *buildSuccessMatcher) Match(actual interface{}) (bool, error) {
+	result, err := asBuildResult(actual)
+	if err != nil {
+		return false, err
+	}
+	return result.BuildSuccess, nil
+}
+
+func (m *buildSuccessMatcher) FailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, "to have succeeded")
+}
+
+func (m *buildSuccessMatcher) NegatedFailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, "not to have succeeded")
+}
+
+// HaveFailedWithReason succeeds if the BuildResult's build failed with the given
+// status reason (build.Status.Reason).
+func HaveFailedWithReason(reason buildv1.StatusReason) types.GomegaMatcher {
+	return &buildFailureReasonMatcher{reason: reason}
+}
+
+type buildFailureReasonMatcher struct {
+	reason buildv1.StatusReason
+}
+
+func (m *buildFailureReasonMatcher) Match(actual interface{}) (bool, error) {
+	result, err := asBuildResult(actual)
+	if err != nil {
+		return false, err
+	}
+	if !result.BuildFailure || result.Build == nil {
+		return false, nil
+	}
+	return result.Build.Status.Reason == m.reason, nil
+}
+
+func (m *buildFailureReasonMatcher) FailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, fmt.Sprintf("to have failed with reason %q", m.reason))
+}
+
+func (m *buildFailureReasonMatcher) NegatedFailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, fmt.Sprintf("not to have failed with reason %q", m.reason))
+}
+
+// HaveBuildPhase succeeds if the BuildResult's build is in the given phase.
+func HaveBuildPhase(phase buildv1.BuildPhase) types.GomegaMatcher {
+	return &buildPhaseMatcher{phase: phase}
+}
+
+type buildPhaseMatcher struct {
+	phase buildv1.BuildPhase
+}
+
+func (m *buildPhaseMatcher) Match(actual interface{}) (bool, error) {
+	result, err := asBuildResult(actual)
+	if err != nil {
+		return false, err
+	}
+	if result.Build == nil {
+		return false, nil
+	}
+	return result.Build.Status.Phase == m.phase, nil
+}
+
+func (m *buildPhaseMatcher) FailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, fmt.Sprintf("to have build phase %q", m.phase))
+}
+
+func (m *buildPhaseMatcher) NegatedFailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, fmt.Sprintf("not to have build phase %q", m.phase))
+}
+
+// HavePushedImageTo succeeds if the BuildResult's build pushed its output image to the
+// given docker image reference.
+func HavePushedImageTo(ref string) types.GomegaMatcher {
+	return &pushedImageMatcher{ref: ref}
+}
+
+type pushedImageMatcher struct {
+	ref string
+}
+
+func (m *pushedImageMatcher) Match(actual interface{}) (bool, error) {
+	result, err := asBuildResult(actual)
+	if err != nil {
+		return false, err
+	}
+	if result.Build == nil {
+		return false, nil
+	}
+	return result.Build.Status.OutputDockerImageReference == m.ref, nil
+}
+
+func (m *pushedImageMatcher) FailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, fmt.Sprintf("to have pushed its output image to %q", m.ref))
+}
+
+func (m *pushedImageMatcher) NegatedFailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, fmt.Sprintf("not to have pushed its output image to %q", m.ref))
+}
+
+// HaveBuildDurationLessThan succeeds if the BuildResult's build completed in less than
+// the given duration, measured from Status.StartTimestamp to Status.CompletionTimestamp.
+func HaveBuildDurationLessThan(d time.Duration) types.GomegaMatcher {
+	return &buildDurationMatcher{max: d}
+}
+
+type buildDurationMatcher struct {
+	max time.Duration
+}
+
+func (m *buildDurationMatcher) Match(actual interface{}) (bool, error) {
+	result, err := asBuildResult(actual)
+	if err != nil {
+		return false, err
+	}
+	if result.Build == nil || result.Build.Status.StartTimestamp.IsZero() || result.Build.Status.CompletionTimestamp == nil {
+		return false, nil
+	}
+	duration := result.Build.Status.CompletionTimestamp.Sub(result.Build.Status.StartTimestamp.Time)
+	return duration < m.max, nil
+}
+
+func (m *buildDurationMatcher) FailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, fmt.Sprintf("to have a build duration less than %s", m.max))
+}
+
+func (m *buildDurationMatcher) NegatedFailureMessage(actual interface{}) string {
+	return withDiagnostics(actual, fmt.Sprintf("not to have a build duration less than %s", m.max))
+}
+
+func asBuildResult(actual interface{}) (*util.BuildResult, error) {
+	result, ok := actual.(*util.BuildResult)
+	if !ok {
+		return nil, fmt.Errorf("expected a *util.BuildResult, got %T", actual)
+	}
+	if result == nil {
+		return nil, fmt.Errorf("expected a non-nil *util.BuildResult")
+	}
+	return result, nil
+}
+
+// withDiagnostics builds a matcher failure message the usual Gomega way, then appends
+// failureDiagnostics' build phase/reason/registry/log detail so a failing assertion
+// doesn't send the reader straight to result.DumpLogs() to find out why.
+func withDiagnostics(actual interface{}, message string) string {
+	base := format.Message(actual, message)
+	result, err := asBuildResult(actual)
+	if err != nil {
+		return base
+	}
+	return base + "\n" + failureDiagnostics(result)
+}
+
+// failureDiagnostics renders the build's phase, failure reason, pushed image reference,
+// and the last tailLogLines lines of its log.
+func failureDiagnostics(result *util.BuildResult) string {
+	var phase buildv1.BuildPhase
+	var reason buildv1.StatusReason
+	var registry string
+	if result.Build != nil {
+		phase = result.Build.Status.Phase
+		reason = result.Build.Status.Reason
+		registry = result.Build.Status.OutputDockerImageReference
+	}
+
+	var logs bytes.Buffer
+	if _, err := result.LogsNoTimestamp(&logs); err != nil {
+		return fmt.Sprintf("phase: %q, reason: %q, registry: %q (error retrieving logs: %v)", phase, reason, registry, err)
+	}
+
+	return fmt.Sprintf("phase: %q, reason: %q, registry: %q\nlast %d log lines:\n%s",
+		phase, reason, registry, tailLogLines, tailLines(logs.String(), tailLogLines))
+}
+
+// tailLines returns the last n lines of s.
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
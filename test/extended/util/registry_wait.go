@@ -0,0 +1,269 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+)
+
+// RegistryHostnameReadyEvent captures what WaitForInternalRegistryHostnameCtx observed
+// when it concluded the internal registry hostname had been published: the hostname
+// itself, the OCM generation that had observed it, and the OCM pods whose logs
+// confirmed the build controller restarted after that observation.
+type RegistryHostnameReadyEvent struct {
+	Hostname        string
+	OCMGeneration   int64
+	ConfirmedByPods []string
+}
+
+// ocmLogScanState is a tiny per-pod state machine that advances one log line at a
+// time, rather than re-scanning an entire pod log from the top on every poll: first it
+// looks for the docker_registry_service.go line naming the hostname, then for the
+// build_controller.go "Starting build controller" line that follows it.
+type ocmLogScanState struct {
+	sawHostnameLine bool
+	confirmed       bool
+}
+
+func (s *ocmLogScanState) scan(line, hostname string) {
+	if s.confirmed {
+		return
+	}
+	if !s.sawHostnameLine {
+		if strings.Contains(line, "docker_registry_service.go") && strings.Contains(line, hostname) {
+			s.sawHostnameLine = true
+		}
+		return
+	}
+	if strings.Contains(line, "build_controller.go") && strings.Contains(line, "Starting build controller") {
+		s.confirmed = true
+	}
+}
+
+// WaitForInternalRegistryHostname waits for the internal registry hostname to be made
+// available to the cluster. It is a 2 minute bounded convenience wrapper around
+// WaitForInternalRegistryHostnameCtx for callers that do not need their own deadline.
+func WaitForInternalRegistryHostname(oc *CLI) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	event, err := WaitForInternalRegistryHostnameCtx(ctx, oc)
+	if err != nil {
+		return "", err
+	}
+	return event.Hostname, nil
+}
+
+// WaitForInternalRegistryHostnameCtx waits, bounded by ctx, for the internal registry
+// hostname to be published to the cluster Images config, observed by the
+// OpenShiftControllerManager operator config, and for at least one
+// openshift-controller-manager pod's build controller to have restarted after
+// observing it.
+//
+// The original implementation polled every 2 seconds, re-listing OCM pods and
+// re-reading each pod's entire log stream on every iteration. This instead opens a
+// single watch on Images, a single watch on the OCM operator config, a watch on the
+// OCM pods, and a follow-mode log tail per OCM pod whose lines advance a small
+// per-pod state machine, so repeated log content is never re-scanned.
+func WaitForInternalRegistryHostnameCtx(ctx context.Context, oc *CLI) (*RegistryHostnameReadyEvent, error) {
+	e2e.Logf("Waiting for the internal registry hostname to be published")
+
+	imageWatch, err := oc.AsAdmin().AdminConfigClient().ConfigV1().Images().Watch(metav1.ListOptions{FieldSelector: fields.Set{"metadata.name": "cluster"}.AsSelector().String()})
+	if err != nil {
+		return nil, err
+	}
+	defer imageWatch.Stop()
+
+	ocmWatch, err := oc.AdminOperatorClient().OperatorV1().OpenShiftControllerManagers().Watch(metav1.ListOptions{FieldSelector: fields.Set{"metadata.name": "cluster"}.AsSelector().String()})
+	if err != nil {
+		return nil, err
+	}
+	defer ocmWatch.Stop()
+
+	podWatch, err := oc.AdminKubeClient().CoreV1().Pods("openshift-controller-manager").Watch(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer podWatch.Stop()
+
+	var (
+		hostname           string
+		ocmGeneration      int64
+		lastOCM            *operatorv1.OpenShiftControllerManager
+		ocmObservedMatches bool
+		ocmNotProgressing  bool
+		scanStates         = map[string]*ocmLogScanState{}
+		confirmed          = map[string]bool{}
+		stopFollow         = map[string]context.CancelFunc{}
+	)
+
+	// recomputeOCMStatus re-runs observedHostnameMatches/isNotProgressing against the
+	// last-seen OCM object and the current hostname. It must be called from both the
+	// imageWatch and ocmWatch branches below: there's no ordering guarantee between the
+	// two watches' initial events, so if the OCM watch's first event arrives before
+	// hostname is known, ocmObservedMatches would otherwise latch false against an empty
+	// hostname and never get re-evaluated.
+	recomputeOCMStatus := func() {
+		if lastOCM == nil {
+			return
+		}
+		ocmObservedMatches = observedHostnameMatches(lastOCM, hostname)
+		ocmNotProgressing = isNotProgressing(lastOCM)
+	}
+	defer func() {
+		for _, cancel := range stopFollow {
+			cancel()
+		}
+	}()
+
+	lines := make(chan string, 256)
+
+	followPod := func(podName string) {
+		if _, ok := stopFollow[podName]; ok {
+			return
+		}
+		podCtx, cancel := context.WithCancel(ctx)
+		req := oc.AdminKubeClient().CoreV1().Pods("openshift-controller-manager").GetLogs(podName, &corev1.PodLogOptions{Follow: true})
+		readCloser, err := req.Stream()
+		if err != nil {
+			// Leave stopFollow/scanStates unset so a later watch event for this same pod
+			// (e.g. once it leaves Pending/ContainerCreating) retries instead of hitting
+			// the stopFollow guard above and being silently dropped forever.
+			cancel()
+			e2e.Logf("error opening follow-mode logs for pod %s: %v", podName, err)
+			return
+		}
+		stopFollow[podName] = cancel
+		scanStates[podName] = &ocmLogScanState{}
+		go func() {
+			<-podCtx.Done()
+			readCloser.Close()
+		}()
+		go func() {
+			defer readCloser.Close()
+			scanner := bufio.NewScanner(readCloser)
+			for scanner.Scan() {
+				select {
+				case lines <- podName + "\x00" + scanner.Text():
+				case <-podCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	ready := func() (*RegistryHostnameReadyEvent, bool) {
+		if len(hostname) == 0 || !ocmObservedMatches || !ocmNotProgressing {
+			return nil, false
+		}
+		var confirmedPods []string
+		for name, ok := range confirmed {
+			if ok {
+				confirmedPods = append(confirmedPods, name)
+			}
+		}
+		if len(confirmedPods) == 0 {
+			return nil, false
+		}
+		return &RegistryHostnameReadyEvent{Hostname: hostname, OCMGeneration: ocmGeneration, ConfirmedByPods: confirmedPods}, true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for internal registry hostname to be published")
+
+		case evt, ok := <-imageWatch.ResultChan():
+			if !ok {
+				return nil, fmt.Errorf("watch on image config closed unexpectedly")
+			}
+			if imageConfig, ok := evt.Object.(*configv1.Image); ok {
+				hostname = imageConfig.Status.InternalRegistryHostname
+				recomputeOCMStatus()
+			}
+
+		case evt, ok := <-ocmWatch.ResultChan():
+			if !ok {
+				return nil, fmt.Errorf("watch on openshiftcontrollermanagers closed unexpectedly")
+			}
+			if ocm, ok := evt.Object.(*operatorv1.OpenShiftControllerManager); ok {
+				ocmGeneration = ocm.Generation
+				lastOCM = ocm
+				recomputeOCMStatus()
+			}
+
+		case evt, ok := <-podWatch.ResultChan():
+			if !ok {
+				return nil, fmt.Errorf("watch on openshift-controller-manager pods closed unexpectedly")
+			}
+			if evt.Type == watch.Deleted {
+				continue
+			}
+			if pod, ok := evt.Object.(*corev1.Pod); ok {
+				followPod(pod.Name)
+			}
+
+		case line := <-lines:
+			parts := strings.SplitN(line, "\x00", 2)
+			if len(parts) != 2 || len(hostname) == 0 {
+				continue
+			}
+			podName, text := parts[0], parts[1]
+			state, ok := scanStates[podName]
+			if !ok {
+				continue
+			}
+			state.scan(text, hostname)
+			if state.confirmed {
+				confirmed[podName] = true
+			}
+		}
+
+		if event, ok := ready(); ok {
+			e2e.Logf("internal registry hostname %s confirmed ready by pods %v", event.Hostname, event.ConfirmedByPods)
+			return event, nil
+		}
+	}
+}
+
+// observedHostnameMatches reports whether the OCM operator's observed config agrees
+// with the image config's internal registry hostname, the same comparison the
+// original polling implementation made against ObservedConfig.Raw.
+func observedHostnameMatches(ocm *operatorv1.OpenShiftControllerManager, hostname string) bool {
+	if len(hostname) == 0 {
+		return false
+	}
+	observedConfig := map[string]interface{}{}
+	if err := json.Unmarshal(ocm.Spec.ObservedConfig.Raw, &observedConfig); err != nil {
+		return false
+	}
+	current, _, err := unstructured.NestedString(observedConfig, "dockerPullSecret", "internalRegistryHostname")
+	if err != nil {
+		return false
+	}
+	return current == hostname
+}
+
+// isNotProgressing reports whether the OCM operator's Progressing condition is False.
+func isNotProgressing(ocm *operatorv1.OpenShiftControllerManager) bool {
+	for _, condition := range ocm.Status.Conditions {
+		if condition.Type != operatorv1.OperatorStatusTypeProgressing {
+			continue
+		}
+		return condition.Status == operatorv1.ConditionFalse
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// StreamingExecutor runs commands inside a specific pod over the apiserver's exec
+// subresource using client-go's SPDY executor directly, rather than shelling out to
+// "oc exec"; podExecutor, FetchURL and MultiContainerPod run their commands through
+// it. This gives
+// callers real stdin/stdout/stderr streams, a context-aware cancellation point, and
+// the command's exit code instead of only an error.
+type StreamingExecutor struct {
+	RESTConfig *restclient.Config
+	RESTClient restclient.Interface
+	Namespace  string
+	PodName    string
+}
+
+// NewStreamingExecutor returns a StreamingExecutor for the named pod in oc's namespace.
+func NewStreamingExecutor(oc *CLI, podName string) *StreamingExecutor {
+	return &StreamingExecutor{
+		RESTConfig: oc.AdminConfig(),
+		RESTClient: oc.AdminKubeClient().CoreV1().RESTClient(),
+		Namespace:  oc.Namespace(),
+		PodName:    podName,
+	}
+}
+
+// Exec runs cmd in container, streaming stdin/stdout/stderr as they're supplied, and
+// returns the command's exit code. It aborts if ctx is done before the command
+// finishes; the remote process itself is not guaranteed to stop, matching
+// remotecommand's own cancellation semantics.
+func (e *StreamingExecutor) Exec(ctx context.Context, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	req := e.RESTClient.Post().
+		Resource("pods").
+		Name(e.PodName).
+		Namespace(e.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   cmd,
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(e.RESTConfig, "POST", req.URL())
+	if err != nil {
+		return 0, fmt.Errorf("error creating SPDY executor for pod %s/%s: %v", e.Namespace, e.PodName, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- executor.Stream(remotecommand.StreamOptions{Stdin: stdin, Stdout: stdout, Stderr: stderr})
+	}()
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case err := <-done:
+		if err == nil {
+			return 0, nil
+		}
+		if exitErr, ok := err.(utilexec.CodeExitError); ok {
+			return exitErr.ExitStatus(), exitErr
+		}
+		return 0, err
+	}
+}
+
+// Output runs cmd in container and returns its combined stdout and stderr.
+func (e *StreamingExecutor) Output(ctx context.Context, container string, cmd []string) (string, error) {
+	var buf bytes.Buffer
+	_, err := e.Exec(ctx, container, cmd, nil, &buf, &buf)
+	return buf.String(), err
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"context"
+	"time"
+
+	e2e "k8s.io/kubernetes/test/e2e/framework"
+)
+
+// WaitOptions configures the Wait* helpers in this package: how long to wait overall,
+// how often to re-check state, what context to honor for cancellation in addition to
+// the timeout, and where to send progress messages. The zero value, combined with
+// each helper's own defaultTimeout/defaultPollInterval, preserves that helper's
+// historical hard-coded behavior.
+type WaitOptions struct {
+	Timeout      time.Duration
+	PollInterval time.Duration
+	Context      context.Context
+	Logf         func(format string, args ...interface{})
+}
+
+// WaitOption mutates a WaitOptions in place.
+type WaitOption func(*WaitOptions)
+
+// WithTimeout overrides the overall deadline a Wait* helper waits before giving up.
+// Tests running against slow clusters (bare-metal, disconnected) can raise this
+// without forking the framework.
+func WithTimeout(d time.Duration) WaitOption {
+	return func(o *WaitOptions) { o.Timeout = d }
+}
+
+// WithPollInterval overrides how often a Wait* helper re-checks state.
+func WithPollInterval(d time.Duration) WaitOption {
+	return func(o *WaitOptions) { o.PollInterval = d }
+}
+
+// WithContext lets a Wait* helper be cancelled by the caller's context, in addition to
+// its own timeout.
+func WithContext(ctx context.Context) WaitOption {
+	return func(o *WaitOptions) { o.Context = ctx }
+}
+
+// WithLogger overrides the progress logging function a Wait* helper uses; it defaults
+// to e2e.Logf.
+func WithLogger(logf func(format string, args ...interface{})) WaitOption {
+	return func(o *WaitOptions) { o.Logf = logf }
+}
+
+// resolveWaitOptions seeds a WaitOptions from a helper's own defaults, applies opts on
+// top, and fills in any fields that were never set.
+func resolveWaitOptions(defaultTimeout, defaultPollInterval time.Duration, opts ...WaitOption) WaitOptions {
+	o := WaitOptions{Timeout: defaultTimeout, PollInterval: defaultPollInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Context == nil {
+		o.Context = context.Background()
+	}
+	if o.Logf == nil {
+		o.Logf = e2e.Logf
+	}
+	return o
+}
+
+// boundedContext returns a context that is done when either o.Context is done or
+// o.Timeout elapses, plus its cancel func.
+func (o WaitOptions) boundedContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(o.Context, o.Timeout)
+}